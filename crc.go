@@ -0,0 +1,59 @@
+package mkvparse
+
+import (
+	"fmt"
+	"hash/crc32"
+)
+
+// CRCMismatchError is returned by Parse and ParseSections when
+// ParserOptions.VerifyCRC is enabled and a Master element's CRC-32 child
+// does not match the computed checksum of the rest of the Master's payload.
+type CRCMismatchError struct {
+	Element  ElementID
+	Expected uint32
+	Actual   uint32
+}
+
+func (e *CRCMismatchError) Error() string {
+	return fmt.Sprintf("mkvparse: CRC-32 mismatch in %s: expected %08x, got %08x",
+		elementNames[e.Element], e.Expected, e.Actual)
+}
+
+// crcVerifier accumulates the bytes of a Master element's payload so they
+// can be checked against a leading CRC-32 element (ID 0xBF) once the Master
+// has been fully read. The EBML CRC-32 is the IEEE polynomial over the
+// reflected bit order, i.e. the same algorithm as hash/crc32.IEEETable.
+//
+// A verifier is only created when ParserOptions.VerifyCRC is set and the
+// enclosing Master was entered by sequential parsing; Masters entered via a
+// seek have no way to recover the bytes preceding the seek point, so CRC
+// verification is skipped for them.
+type crcVerifier struct {
+	element  ElementID
+	hash     uint32
+	expected uint32
+	haveCRC  bool
+}
+
+func newCRCVerifier(element ElementID) *crcVerifier {
+	return &crcVerifier{element: element}
+}
+
+func (v *crcVerifier) write(p []byte) {
+	v.hash = crc32.Update(v.hash, crc32.IEEETable, p)
+}
+
+func (v *crcVerifier) setExpected(value uint32) {
+	v.expected = value
+	v.haveCRC = true
+}
+
+func (v *crcVerifier) verify() error {
+	if !v.haveCRC {
+		return nil
+	}
+	if v.hash != v.expected {
+		return &CRCMismatchError{Element: v.element, Expected: v.expected, Actual: v.hash}
+	}
+	return nil
+}
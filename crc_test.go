@@ -0,0 +1,100 @@
+package mkvparse
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"testing"
+	"time"
+)
+
+// noopHandler implements Handler with every method a no-op. Tests embed or
+// instantiate it directly when they only care about the error Parse
+// returns, not the decoded values.
+type noopHandler struct{}
+
+func (noopHandler) HandleMasterBegin(ElementID, ElementInfo) (bool, error) { return true, nil }
+func (noopHandler) HandleMasterEnd(ElementID, ElementInfo) error           { return nil }
+func (noopHandler) HandleString(ElementID, string, ElementInfo) error      { return nil }
+func (noopHandler) HandleUTF8(ElementID, string, ElementInfo) error        { return nil }
+func (noopHandler) HandleInteger(ElementID, int64, ElementInfo) error      { return nil }
+func (noopHandler) HandleUInteger(ElementID, uint64, ElementInfo) error    { return nil }
+func (noopHandler) HandleFloat(ElementID, float64, ElementInfo) error      { return nil }
+func (noopHandler) HandleDate(ElementID, time.Time, ElementInfo) error     { return nil }
+func (noopHandler) HandleBinary(ElementID, []byte, ElementInfo) error      { return nil }
+
+// encodeID returns id's VINT-encoded bytes using the minimum number of
+// significant bytes its value needs, mirroring mkvwriter's idSize without
+// depending on that package from here.
+func encodeID(id ElementID) []byte {
+	v := uint32(id)
+	switch {
+	case v&0xFFFFFF00 == 0:
+		return []byte{byte(v)}
+	case v&0xFFFF0000 == 0:
+		return []byte{byte(v >> 8), byte(v)}
+	case v&0xFF000000 == 0:
+		return []byte{byte(v >> 16), byte(v >> 8), byte(v)}
+	default:
+		return []byte{byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)}
+	}
+}
+
+// encodeSizeVInt encodes n as an EBML size VINT using the fewest
+// length-descriptor bits.
+func encodeSizeVInt(n uint64) []byte {
+	size := 1
+	for size < 8 && n >= uint64(1)<<(uint(size)*7)-1 {
+		size++
+	}
+	buf := make([]byte, size)
+	for i := size - 1; i >= 0; i-- {
+		buf[i] = byte(n)
+		n >>= 8
+	}
+	buf[0] |= 1 << uint(8-size)
+	return buf
+}
+
+// encodeElement encodes id's header followed by payload verbatim.
+func encodeElement(id ElementID, payload []byte) []byte {
+	buf := append(encodeID(id), encodeSizeVInt(uint64(len(payload)))...)
+	return append(buf, payload...)
+}
+
+// buildSegmentWithCRC encodes an EBML header (DocType "matroska") followed
+// by a Segment Master whose first child is a CRC-32 covering a single
+// Title string child. If corrupt is true, the Title payload is mutated
+// after the checksum is computed so the CRC-32 no longer matches.
+func buildSegmentWithCRC(corrupt bool) []byte {
+	title := encodeElement(TitleElement, []byte("Hello"))
+	sum := crc32.ChecksumIEEE(title)
+	if corrupt {
+		title[len(title)-1] ^= 0xFF
+	}
+
+	crcPayload := make([]byte, 4)
+	binary.LittleEndian.PutUint32(crcPayload, sum)
+	crcChild := encodeElement(CRC32Element, crcPayload)
+
+	segment := encodeElement(SegmentElement, append(crcChild, title...))
+	header := encodeElement(EBMLElement, encodeElement(DocTypeElement, []byte("matroska")))
+	return append(header, segment...)
+}
+
+func TestVerifyCRCAcceptsMatchingChecksum(t *testing.T) {
+	data := buildSegmentWithCRC(false)
+	if err := Parse(bytes.NewReader(data), noopHandler{}, ParserOptions{VerifyCRC: true}); err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+}
+
+func TestVerifyCRCRejectsCorruptedPayload(t *testing.T) {
+	data := buildSegmentWithCRC(true)
+	err := Parse(bytes.NewReader(data), noopHandler{}, ParserOptions{VerifyCRC: true})
+	var mismatch *CRCMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("Parse returned %v, want a *CRCMismatchError", err)
+	}
+}
@@ -0,0 +1,31 @@
+package mkvparse
+
+import "fmt"
+
+// EnumValidationError is returned by Parse and ParseSections when
+// ParserOptions.StrictEnums is enabled and a restricted element's parsed
+// value is not one of its allowed members.
+type EnumValidationError struct {
+	Element ElementID
+	Value   interface{}
+	Allowed []string
+}
+
+func (e *EnumValidationError) Error() string {
+	return fmt.Sprintf("mkvparse: %v is not a valid value for %s (allowed: %v)",
+		e.Value, elementNames[e.Element], e.Allowed)
+}
+
+// checkEnum validates value against el's enum restriction, if any. It
+// returns nil for elements with no restriction, and an *EnumValidationError
+// naming the allowed members if value is out of range.
+func checkEnum(el ElementID, value interface{}) error {
+	labels := enumMembers(el)
+	if labels == nil {
+		return nil
+	}
+	if _, ok := EnumLabel(el, value); ok {
+		return nil
+	}
+	return &EnumValidationError{Element: el, Value: value, Allowed: labels}
+}
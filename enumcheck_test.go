@@ -0,0 +1,52 @@
+package mkvparse
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// encodeUInt encodes value as a minimal big-endian uinteger payload, the
+// same encoding a uinteger-typed element's bytes use on the wire.
+func encodeUInt(value uint64) []byte {
+	size := 1
+	for v := value >> 8; v != 0; v >>= 8 {
+		size++
+	}
+	buf := make([]byte, 8)
+	for i := 7; i >= 0; i-- {
+		buf[i] = byte(value)
+		value >>= 8
+	}
+	return buf[8-size:]
+}
+
+func buildTrackTypeStream(value uint64) []byte {
+	header := encodeElement(EBMLElement, encodeElement(DocTypeElement, []byte("matroska")))
+	trackType := encodeElement(TrackTypeElement, encodeUInt(value))
+	segment := encodeElement(SegmentElement, trackType)
+	return append(header, segment...)
+}
+
+// TestStrictEnumsRejectsOutOfRangeValue checks that an out-of-range value
+// for a restricted element stops parsing with an *EnumValidationError
+// instead of silently reaching the Handler, the behavior StrictEnums
+// defined but never actually triggered until this commit.
+func TestStrictEnumsRejectsOutOfRangeValue(t *testing.T) {
+	data := buildTrackTypeStream(99) // not one of TrackTypeElement's allowed members
+	err := Parse(bytes.NewReader(data), noopHandler{}, ParserOptions{StrictEnums: true})
+	var invalid *EnumValidationError
+	if !errors.As(err, &invalid) {
+		t.Fatalf("Parse returned %v, want an *EnumValidationError", err)
+	}
+	if invalid.Element != TrackTypeElement {
+		t.Fatalf("EnumValidationError.Element = %v, want TrackTypeElement", invalid.Element)
+	}
+}
+
+func TestStrictEnumsAcceptsValidValue(t *testing.T) {
+	data := buildTrackTypeStream(uint64(TrackType_Video))
+	if err := Parse(bytes.NewReader(data), noopHandler{}, ParserOptions{StrictEnums: true}); err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+}
@@ -22,6 +22,12 @@ func main() {
 	if err := generateElements(); err != nil {
 		log.Fatalf("%v", err)
 	}
+	if err := generateSchemas(); err != nil {
+		log.Fatalf("%v", err)
+	}
+	if err := generateWriter(); err != nil {
+		log.Fatalf("%v", err)
+	}
 	if err := generateTags(); err != nil {
 		log.Fatalf("%v", err)
 	}
@@ -50,6 +56,7 @@ type EBMLSchemaElement struct {
 		Path string
 		Name string
 	} `xml:"-"`
+	Parent string `xml:"-"`
 }
 
 type EBMLSchemaEnum struct {
@@ -63,60 +70,130 @@ var pathCountCleanRE = regexp.MustCompile(`\d*\*\d*\(|\(|\)`)
 var pathRE = regexp.MustCompile(`\\(\(\d*-\d*\\\))?(.*)`)
 
 func generateElements() error {
+	elements, err := loadElements()
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Generating elements.go ...")
+
+	var buf bytes.Buffer
+	if err := elementsTemplate.Execute(&buf, elements); err != nil {
+		return err
+	}
+
+	// log.Printf("Pre-format: %s", buf.String())
+	formatted, err := format.Source(buf.Bytes())
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile("elements.go", formatted, 0644)
+}
+
+// schemaSource describes one upstream EBML schema XML document. Each
+// source is also generated into its own Schema implementation by
+// generateSchemas, with containment computed from that source alone;
+// loadElements still merges all sources into the shared ElementID/name
+// table and the writer's element list.
+type schemaSource struct {
+	Name   string // Go identifier suffix, e.g. "EBMLHeader", "MatroskaV4"
+	URL    string
+	Legacy bool // true if Path uses the older "n*m(\Path)" occurrence syntax
+}
+
+var schemaSources = []schemaSource{
+	{Name: "EBMLHeader", URL: "https://raw.githubusercontent.com/ietf-wg-cellar/ebml-specification/master/ebml.xml"},
+	// "https://raw.githubusercontent.com/ietf-wg-cellar/matroska-specification/master/ebml_matroska.xml",
+	{Name: "MatroskaV4", URL: "https://raw.githubusercontent.com/ietf-wg-cellar/matroska-specification/v03/ebml_matroska.xml", Legacy: true},
+}
+
+// loadElements downloads and merges all schemaSources into the flat,
+// deduplicated element catalog consumed by elementsTemplate (the shared
+// ElementID/name table) and by the writer (writerTemplate) generator. The
+// WebM-only elements from webmAddedElements are folded in too, even though
+// no schemaSource carries them, so schema_webm.go's references to them
+// resolve to real constants.
+func loadElements() ([]*EBMLSchemaElement, error) {
 	var elements []*EBMLSchemaElement
 	haveElement := map[string]bool{}
-	for _, schema := range []string{
-		"https://raw.githubusercontent.com/ietf-wg-cellar/ebml-specification/master/ebml.xml",
-		// "https://raw.githubusercontent.com/ietf-wg-cellar/matroska-specification/master/ebml_matroska.xml",
-		"https://raw.githubusercontent.com/ietf-wg-cellar/matroska-specification/v03/ebml_matroska.xml",
-	} {
-		isLegacySchema := strings.HasSuffix(schema, "ebml_matroska.xml")
-		sb, err := loadSchema(schema)
+	for _, src := range schemaSources {
+		els, err := fetchSchemaElements(src, haveElement)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		defer sb.Close()
-		data, err := ioutil.ReadAll(sb)
-		if err != nil {
-			return err
+		elements = append(elements, els...)
+	}
+	for _, el := range webmAddedElements() {
+		if haveElement[el.Name] {
+			continue
 		}
-		table := ElementsTable{}
-		err = xml.Unmarshal(data, &table)
-		if err != nil {
-			return err
+		haveElement[el.Name] = true
+		elements = append(elements, el)
+	}
+	return finalizeElements(elements), nil
+}
+
+// loadSchemaSource downloads a single schemaSource and returns its own
+// self-contained element list, with IsRoot/Descendants/Parent computed
+// relative only to that source's own elements.
+func loadSchemaSource(src schemaSource) ([]*EBMLSchemaElement, error) {
+	elements, err := fetchSchemaElements(src, map[string]bool{})
+	if err != nil {
+		return nil, err
+	}
+	return finalizeElements(elements), nil
+}
+
+// fetchSchemaElements downloads and decodes src, skipping any element name
+// already present in haveElement (and recording the ones it adds).
+func fetchSchemaElements(src schemaSource, haveElement map[string]bool) ([]*EBMLSchemaElement, error) {
+	sb, err := loadSchema(src.URL)
+	if err != nil {
+		return nil, err
+	}
+	defer sb.Close()
+	data, err := ioutil.ReadAll(sb)
+	if err != nil {
+		return nil, err
+	}
+	table := ElementsTable{}
+	if err := xml.Unmarshal(data, &table); err != nil {
+		return nil, err
+	}
+
+	var elements []*EBMLSchemaElement
+	for _, el := range table.Elements {
+		if _, ok := haveElement[el.Name]; ok {
+			continue
 		}
-		for _, el := range table.Elements {
-			if _, ok := haveElement[el.Name]; ok {
-				continue
+		haveElement[el.Name] = true
+		if src.Legacy {
+			el.Path = pathCountCleanRE.ReplaceAllString(el.Path, "")
+		}
+
+		var enums []*EBMLSchemaEnum
+		enumNames := map[string]struct{}{}
+		for i, e := range el.Restriction.Enums {
+			e.Name = camelCase(e.Label)
+			if e.Name == "Reserved" {
+				e.Name = fmt.Sprintf("Reserved%d", i)
 			}
-			haveElement[el.Name] = true
-			if isLegacySchema {
-				el.Path = pathCountCleanRE.ReplaceAllString(el.Path, "")
+			if _, ok := enumNames[e.Name]; ok {
+				continue
 			}
-
-			var enums []*EBMLSchemaEnum
-			enumNames := map[string]struct{}{}
-			for i, e := range el.Restriction.Enums {
-				e.Name = camelCase(e.Label)
-				if e.Name == "Reserved" {
-					e.Name = fmt.Sprintf("Reserved%d", i)
-				}
-				if _, ok := enumNames[e.Name]; ok {
-					continue
-				}
-				if el.Type == "string" {
-					e.Type = "string"
-					e.Value = fmt.Sprintf("\"%s\"", e.Value)
-				} else {
-					e.Type = "int64"
-				}
-				enums = append(enums, e)
-				enumNames[e.Name] = struct{}{}
+			if el.Type == "string" {
+				e.Type = "string"
+				e.Value = fmt.Sprintf("\"%s\"", e.Value)
+			} else {
+				e.Type = "int64"
 			}
-			el.Restriction.Enums = enums
-
-			elements = append(elements, el)
+			enums = append(enums, e)
+			enumNames[e.Name] = struct{}{}
 		}
+		el.Restriction.Enums = enums
+
+		elements = append(elements, el)
 	}
 
 	// Add legacy named fields
@@ -128,8 +205,13 @@ func generateElements() error {
 	// 	{Name: "TrackTimeCodeScale", ID: "TrackTimestampScaleElement", Deprecated: true, Type: "float"},
 	// }...)
 
-	log.Printf("Generating elements.go ...")
+	return elements, nil
+}
 
+// finalizeElements normalizes names and computes IsRoot, Descendants and
+// Parent for a self-contained list of elements, then sorts it the way the
+// generated templates expect.
+func finalizeElements(elements []*EBMLSchemaElement) []*EBMLSchemaElement {
 	for _, v := range elements {
 		v.Name = elementName(v.Name)
 		for _, del := range elements {
@@ -144,22 +226,43 @@ func generateElements() error {
 			}
 		}
 	}
+
+	pathByName := map[string]string{}
+	for _, v := range elements {
+		pathByName[cleanPath(v.Path)] = v.Name
+	}
+	for _, v := range elements {
+		if v.IsRoot {
+			continue
+		}
+		if parent, ok := pathByName[parentPath(v.Path)]; ok {
+			v.Parent = parent
+		}
+	}
+
 	sort.Slice(elements, func(i, j int) bool {
 		return strings.Compare(elements[i].Name+"Element", elements[j].Name+"Element") < 0
 	})
 
-	var buf bytes.Buffer
-	if err := elementsTemplate.Execute(&buf, elements); err != nil {
-		return err
-	}
+	return elements
+}
 
-	// log.Printf("Pre-format: %s", buf.String())
-	formatted, err := format.Source(buf.Bytes())
-	if err != nil {
-		return err
-	}
+// cleanPath strips the legacy occurrence wrappers (e.g. "1*1(") and all
+// parentheses from a schema path so it can be compared across the legacy
+// and current schemas; a "(1-)" annotation is left as "1-".
+func cleanPath(p string) string {
+	return pathCountCleanRE.ReplaceAllString(p, "")
+}
 
-	return os.WriteFile("elements.go", formatted, 0644)
+// parentPath returns the path of p's immediate parent element, or "" if p
+// names a root-level element.
+func parentPath(p string) string {
+	clean := cleanPath(p)
+	idx := strings.LastIndex(clean, "\\")
+	if idx <= 0 {
+		return ""
+	}
+	return clean[:idx]
 }
 
 func elementName(n string) string {
@@ -189,16 +292,168 @@ var elementsTemplate = template.Must(template.New("").Parse(`// Code generated b
 
 package mkvparse
 
-// Supported ElementIDs
+// Supported ElementIDs. IDs are shared across all schemas: the same EBML ID
+// always names the same element, even though which schema recognizes or
+// permits it varies. See schema_matroskav4.go, schema_webm.go and
+// schema_ebmlheader.go for the per-schema behavior, and schema.go for how
+// a Schema is selected at parse time.
 const (
 	{{- range . }}
 	{{ .Name }}Element ElementID = {{ .ID -}} {{- if .Deprecated -}}// Deprecated. Do not use.{{- end -}}
 	{{end }}
 )
 
-func getElementType(el ElementID) elementType {
+var elementNames = map[ElementID]string {
+	{{- range . }}
+	{{- if not .Deprecated }}
+	{{ .Name }}Element: {{ printf "%q" .Name }},
+	{{- end -}}
+	{{- end }}
+}
+{{- range . -}}
+{{- if .Restriction.Enums }}
+// Possible {{ .Name}}Element values
+const (
+	{{- $prefix := .Name -}}
+	{{- range .Restriction.Enums }}
+	// {{.Label}}
+	{{$prefix}}_{{.Name}} {{.Type}} = {{.Value}}
+	{{ end -}}
+)
+
+{{ $goType := (index .Restriction.Enums 0).Type -}}
+// {{ .Name }}ElementLabel returns the label for one of {{ .Name }}Element's
+// allowed values, and false if value isn't a recognized member.
+func {{ .Name }}ElementLabel(value {{ $goType }}) (string, bool) {
+	switch value {
+	{{- range .Restriction.Enums }}
+	case {{ $prefix }}_{{ .Name }}:
+		return {{ printf "%q" .Label }}, true
+	{{- end }}
+	}
+	return "", false
+}
+
+// {{ .Name }}ElementValid reports whether value is one of {{ .Name }}Element's
+// allowed values.
+func {{ .Name }}ElementValid(value {{ $goType }}) bool {
+	_, ok := {{ .Name }}ElementLabel(value)
+	return ok
+}
+{{ end -}}
+{{ end -}}
+`))
+
+////////////////////////////////////////////////////////////////////////////////
+// Schemas
+////////////////////////////////////////////////////////////////////////////////
+
+// webmExcludedElements lists Matroska elements that the WebM DocType
+// forbids. WebM has no machine-readable schema of its own -- its
+// restrictions are published as prose in the WebM container guidelines --
+// so the exclusion list is maintained here by hand against the upstream
+// Matroska element set.
+var webmExcludedElements = map[string]bool{
+	"ChapterTranslate":      true,
+	"ChapterTranslateCodec": true,
+	"ChapterTranslateID":    true,
+	"TrackTranslate":        true,
+	"TrackTranslateCodec":   true,
+	"TrackTranslateTrackID": true,
+	"ContentEncryption":     true,
+	"ContentSignature":      true,
+	"ContentSigKeyID":       true,
+	"ContentSigAlgo":        true,
+	"ContentSigHashAlgo":    true,
+}
+
+// webmAddedElements lists elements the WebM DocType carries that the
+// Matroska schema this tree generates from does not, such as the
+// BlockAdditionMapping family under TrackEntry. Like webmExcludedElements,
+// this is maintained by hand against the WebM container guidelines, since
+// WebM has no machine-readable schema of its own.
+func webmAddedElements() []*EBMLSchemaElement {
+	return []*EBMLSchemaElement{
+		{Name: "BlockAdditionMapping", ID: "0x41E4", Type: "master", Path: `\Segment\Tracks\TrackEntry\BlockAdditionMapping`},
+		{Name: "BlockAddIDValue", ID: "0x41F0", Type: "uinteger", Path: `\Segment\Tracks\TrackEntry\BlockAdditionMapping\BlockAddIDValue`},
+		{Name: "BlockAddIDName", ID: "0x41A4", Type: "string", Path: `\Segment\Tracks\TrackEntry\BlockAdditionMapping\BlockAddIDName`},
+		{Name: "BlockAddIDType", ID: "0x41E7", Type: "uinteger", Path: `\Segment\Tracks\TrackEntry\BlockAdditionMapping\BlockAddIDType`},
+		{Name: "BlockAddIDExtraData", ID: "0x41ED", Type: "binary", Path: `\Segment\Tracks\TrackEntry\BlockAdditionMapping\BlockAddIDExtraData`},
+	}
+}
+
+// filterWebMElements derives the WebM element set from an already-loaded
+// MatroskaV4 element list: it drops the elements WebM forbids, adds the
+// elements WebM carries that Matroska doesn't, and runs the result back
+// through finalizeElements so IsRoot/Descendants/Parent are recomputed
+// from the combined Path data.
+func filterWebMElements(elements []*EBMLSchemaElement) []*EBMLSchemaElement {
+	var combined []*EBMLSchemaElement
+	for _, el := range elements {
+		if webmExcludedElements[el.Name] {
+			continue
+		}
+		elCopy := *el
+		elCopy.Descendants = nil
+		combined = append(combined, &elCopy)
+	}
+	combined = append(combined, webmAddedElements()...)
+	return finalizeElements(combined)
+}
+
+// generateSchemas emits one Schema implementation per schemaSources entry,
+// plus the derived SchemaWebM, so the parser can switch element tables
+// based on the DocType declared in a stream's EBML header.
+func generateSchemas() error {
+	var matroskaElements []*EBMLSchemaElement
+	for _, src := range schemaSources {
+		elements, err := loadSchemaSource(src)
+		if err != nil {
+			return err
+		}
+		if src.Name == "MatroskaV4" {
+			matroskaElements = elements
+		}
+		if err := writeSchemaImpl(src.Name, elements); err != nil {
+			return err
+		}
+	}
+
+	return writeSchemaImpl("WebM", filterWebMElements(matroskaElements))
+}
+
+func writeSchemaImpl(name string, elements []*EBMLSchemaElement) error {
+	log.Printf("Generating schema_%s.go ...", strings.ToLower(name))
+
+	var buf bytes.Buffer
+	if err := schemaTemplate.Execute(&buf, struct {
+		GoName   string
+		Elements []*EBMLSchemaElement
+	}{name, elements}); err != nil {
+		return err
+	}
+
+	formatted, err := format.Source(buf.Bytes())
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(fmt.Sprintf("schema_%s.go", strings.ToLower(name)), formatted, 0644)
+}
+
+var schemaTemplate = template.Must(template.New("").Parse(`// Code generated by generate.go.  DO NOT EDIT.
+
+package mkvparse
+
+type schema{{ .GoName }} struct{}
+
+// Schema{{ .GoName }} implements Schema over the {{ .GoName }} element set
+// produced by generate.go.
+var Schema{{ .GoName }} Schema = schema{{ .GoName }}{}
+
+func (schema{{ .GoName }}) ElementType(el ElementID) elementType {
 	switch (el) {
-		{{- range . -}}
+		{{- range .Elements -}}
 		{{- if not .Deprecated }}
 		case {{ .Name }}Element:
 		{{- if eq .Type "master" }}
@@ -225,20 +480,16 @@ func getElementType(el ElementID) elementType {
 	}
 }
 
-var elementNames = map[ElementID]string {
-	{{- range . }}
-	{{- if not .Deprecated }}
-	{{ .Name }}Element: {{ printf "%q" .Name }},
-	{{- end -}}
-	{{- end }}
+func (schema{{ .GoName }}) Name(el ElementID) string {
+	return elementNames[el]
 }
 
-func isDescendantElement(p1, p2 ElementID) bool {
-	switch (p2) {
-		{{ range . -}}
+func (schema{{ .GoName }}) IsDescendant(descendant, ancestor ElementID) bool {
+	switch (ancestor) {
+		{{ range .Elements -}}
 		{{ if eq .Type "master" -}}
 		case {{ .Name }}Element: // {{ .Path }}
-			switch(p1) {
+			switch(descendant) {
 				{{ range .Descendants -}}
 				case {{ .Name }}Element: // {{ .Path }}
 					return true
@@ -253,9 +504,9 @@ func isDescendantElement(p1, p2 ElementID) bool {
 	}
 }
 
-func isRootElement(el ElementID) bool {
+func (schema{{ .GoName }}) IsRoot(el ElementID) bool {
 	switch (el) {
-		{{ range . -}}
+		{{ range .Elements -}}
 		{{ if .IsRoot -}}
 			case {{ .Name }}Element: // {{ .Path }}
 					return true
@@ -265,16 +516,147 @@ func isRootElement(el ElementID) bool {
 			return false
 	}
 }
-{{- range . -}}
-{{- if .Restriction.Enums }}
-// Possible {{ .Name}}Element values
-const (
-	{{- $prefix := .Name -}}
-	{{- range .Restriction.Enums }}
-	// {{.Label}}
-	{{$prefix}}_{{.Name}} {{.Type}} = {{.Value}}
-	{{ end -}}
+
+// EnumLabel returns the label for value if el has an enum restriction
+// under this schema and value is one of its allowed members. value is
+// compared against the restriction's own Go type (int64 for a
+// uinteger/integer restriction, string for a string restriction); a value
+// of any other type, including uint64, is not recognized.
+func (schema{{ .GoName }}) EnumLabel(el ElementID, value interface{}) (string, bool) {
+	switch (el) {
+		{{ range .Elements -}}
+		{{ if .Restriction.Enums -}}
+		case {{ .Name }}Element:
+			v, ok := value.({{ (index .Restriction.Enums 0).Type }})
+			if !ok {
+				return "", false
+			}
+			switch (v) {
+				{{ range .Restriction.Enums -}}
+				case {{ .Value }}:
+					return {{ printf "%q" .Label }}, true
+				{{ end -}}
+			}
+		{{ end -}}
+		{{ end -}}
+	}
+	return "", false
+}
+
+// EnumMembers returns the allowed labels for el under this schema, in
+// declaration order, or nil if el has no enum restriction. It backs
+// StrictEnums' *EnumValidationError, which reports the allowed set.
+func (schema{{ .GoName }}) EnumMembers(el ElementID) []string {
+	switch (el) {
+		{{ range .Elements -}}
+		{{ if .Restriction.Enums -}}
+		case {{ .Name }}Element:
+			return []string{ {{- range .Restriction.Enums }}{{ printf "%q" .Label }}, {{ end -}} }
+		{{ end -}}
+		{{ end -}}
+	}
+	return nil
+}
+`))
+
+////////////////////////////////////////////////////////////////////////////////
+// Writer
+////////////////////////////////////////////////////////////////////////////////
+
+// writerGoType maps an EBML/Matroska element type to the Go type its
+// Write<Name> helper accepts.
+func writerGoType(t string) string {
+	switch t {
+	case "uinteger":
+		return "uint64"
+	case "integer":
+		return "int64"
+	case "float":
+		return "float64"
+	case "utf-8", "string":
+		return "string"
+	case "binary":
+		return "[]byte"
+	case "date":
+		return "time.Time"
+	default:
+		return ""
+	}
+}
+
+func generateWriter() error {
+	elements, err := loadElements()
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Generating mkvwriter/elements_gen.go ...")
+
+	var buf bytes.Buffer
+	if err := writerTemplate.Execute(&buf, elements); err != nil {
+		return err
+	}
+
+	formatted, err := format.Source(buf.Bytes())
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path.Join("mkvwriter", "elements_gen.go"), formatted, 0644)
+}
+
+var writerTemplate = template.Must(template.New("").Funcs(template.FuncMap{
+	"goType": writerGoType,
+}).Parse(`// Code generated by generate.go.  DO NOT EDIT.
+
+package mkvwriter
+
+import (
+	"time"
+
+	"github.com/yacchi/go-mkvparse"
 )
+
+// Scope types statically restrict which Write<Name> helpers may be called
+// while positioned inside a given Master element. Each scope wraps the
+// Writer so callers cannot accidentally write a child into the wrong
+// parent.
+{{ range . -}}
+{{ if eq .Type "master" }}
+// {{ .Name }}Scope is held open between Open{{ .Name }} and Close{{ .Name }}. // {{ .Path }}
+type {{ .Name }}Scope struct {
+	w *Writer
+}
+
+// Open{{ .Name }} starts a new {{ .Name }} Master element. Pass size >= 0 for a
+// known-size element, or UnknownSize on a two-pass Writer to have
+// Close{{ .Name }} backfill the real size; a plain Writer rejects UnknownSize.
+{{ if .IsRoot -}}
+func (w *Writer) Open{{ .Name }}(size int64) ({{ .Name }}Scope, error) {
+	if err := w.openMaster(mkvparse.{{ .Name }}Element, size); err != nil {
+		return {{ .Name }}Scope{}, err
+	}
+	return {{ .Name }}Scope{w: w}, nil
+}
+{{ else -}}
+func (s {{ .Parent }}Scope) Open{{ .Name }}(size int64) ({{ .Name }}Scope, error) {
+	if err := s.w.openMaster(mkvparse.{{ .Name }}Element, size); err != nil {
+		return {{ .Name }}Scope{}, err
+	}
+	return {{ .Name }}Scope{w: s.w}, nil
+}
+{{ end -}}
+
+// Close{{ .Name }} closes the Master element opened by Open{{ .Name }}.
+func (scope {{ .Name }}Scope) Close{{ .Name }}() error {
+	return scope.w.closeMaster(mkvparse.{{ .Name }}Element)
+}
+{{ end -}}
+{{ if and (not .IsRoot) .Parent (ne .Type "master") }}
+// Write{{ .Name }} writes a {{ .Name }} element. // {{ .Path }}
+func (s {{ .Parent }}Scope) Write{{ .Name }}(value {{ goType .Type }}) error {
+	return s.w.write{{ if eq .Type "uinteger" }}UInteger{{ else if eq .Type "integer" }}Integer{{ else if eq .Type "float" }}Float{{ else if eq .Type "utf-8" }}UTF8{{ else if eq .Type "string" }}String{{ else if eq .Type "binary" }}Binary{{ else if eq .Type "date" }}Date{{ end }}(mkvparse.{{ .Name }}Element, value)
+}
 {{ end -}}
 {{ end -}}
 `))
@@ -0,0 +1,37 @@
+package mkvwriter
+
+import (
+	"encoding/binary"
+
+	"github.com/yacchi/go-mkvparse"
+)
+
+// WriteSeekHead writes a SeekHead Master containing one Seek entry per
+// provided (element ID, byte position) pair. Positions are relative to the
+// first byte of the enclosing Segment's payload, per the EBML spec.
+//
+// This is a plain *Writer method rather than a generated Write<Name> helper
+// because its payload (a map of entries) doesn't correspond 1:1 with a
+// single child element.
+func (w *Writer) WriteSeekHead(entries map[mkvparse.ElementID]int64) error {
+	if err := w.openMaster(mkvparse.SeekHeadElement, UnknownSize); err != nil {
+		return err
+	}
+	for id, pos := range entries {
+		if err := w.openMaster(mkvparse.SeekElement, UnknownSize); err != nil {
+			return err
+		}
+		idBuf := make([]byte, 4)
+		binary.BigEndian.PutUint32(idBuf, uint32(id))
+		if err := w.writeBinary(mkvparse.SeekIDElement, idBuf[4-idSize(id):]); err != nil {
+			return err
+		}
+		if err := w.writeUInteger(mkvparse.SeekPositionElement, uint64(pos)); err != nil {
+			return err
+		}
+		if err := w.closeMaster(mkvparse.SeekElement); err != nil {
+			return err
+		}
+	}
+	return w.closeMaster(mkvparse.SeekHeadElement)
+}
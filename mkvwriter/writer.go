@@ -0,0 +1,252 @@
+// Package mkvwriter provides a code-generated, statically-scoped writer for
+// EBML/Matroska streams. It is the write-side counterpart to mkvparse: where
+// mkvparse demuxes a stream into Handle* callbacks, mkvwriter remuxes typed
+// values back into an io.Writer using the same element metadata produced by
+// generate.go.
+//
+// Master elements are opened and closed through generated Open<Name>/
+// Close<Name> pairs that return a <Name>Scope value; every generated
+// Write<Name> helper is a method on the scope of its element's parent, so
+// writing a child into the wrong Master is a compile error rather than a
+// runtime one.
+package mkvwriter
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/yacchi/go-mkvparse"
+)
+
+// UnknownSize, passed to an Open<Name> method, defers the element's size:
+// on a two-pass Writer an 8-octet size field is reserved and the matching
+// Close<Name> backfills the real byte count into it. A plain Writer rejects
+// UnknownSize with an error, so no EBML unknown-size marker is ever left
+// in the output.
+const UnknownSize int64 = -1
+
+// matroskaEpoch is the EBML Date reference point: 2001-01-01T00:00:00 UTC.
+var matroskaEpoch = time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// ElementID is an alias of mkvparse.ElementID so generated Write<Name>
+// helpers can be expressed without importing mkvparse at every call site.
+type ElementID = mkvparse.ElementID
+
+type openElement struct {
+	id         ElementID
+	sizeOffset int64 // offset of the size field, for two-pass backfill; -1 if unknown-size
+}
+
+// Writer sequentially encodes EBML elements to an underlying io.Writer.
+type Writer struct {
+	w      io.Writer
+	ws     io.WriteSeeker // non-nil in two-pass mode
+	offset int64
+	stack  []openElement
+}
+
+// NewWriter returns a Writer that streams elements to w as they are
+// written. Master elements opened with a known size must have that size
+// available up front; use NewTwoPassWriter to buffer a Segment and backfill
+// its size automatically.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: bufio.NewWriter(w)}
+}
+
+// NewTwoPassWriter returns a Writer backed by a io.WriteSeeker so that
+// known-size Master elements (typically Segment) can be opened with
+// UnknownSize up front and have their real size backfilled when their
+// matching Close<Name> is called.
+func NewTwoPassWriter(w io.WriteSeeker) *Writer {
+	return &Writer{w: w, ws: w}
+}
+
+// Flush writes any buffered output. It must be called after the top-level
+// elements have all been closed.
+func (w *Writer) Flush() error {
+	if bw, ok := w.w.(*bufio.Writer); ok {
+		return bw.Flush()
+	}
+	return nil
+}
+
+func (w *Writer) writeRaw(p []byte) error {
+	n, err := w.w.Write(p)
+	w.offset += int64(n)
+	return err
+}
+
+// vintSize returns the number of octets needed to VINT-encode value using
+// the fewest length-descriptor bits, per the EBML spec.
+func vintSize(value uint64) int {
+	for n := 1; n <= 8; n++ {
+		if value < uint64(1)<<(uint(n)*7)-1 {
+			return n
+		}
+	}
+	return 8
+}
+
+// encodeVInt encodes value as an EBML variable-length integer using
+// exactly size octets, setting the leading length-descriptor bit.
+func encodeVInt(value uint64, size int) []byte {
+	buf := make([]byte, size)
+	for i := size - 1; i >= 0; i-- {
+		buf[i] = byte(value)
+		value >>= 8
+	}
+	buf[0] |= 1 << uint(8-size)
+	return buf
+}
+
+// idSize returns the octet count of an element ID, which (unlike a VINT
+// payload) is fixed by its constant value: the EBML spec bakes the length
+// marker into the ID's own leading bits, so it is simply the number of
+// significant bytes in id.
+func idSize(id ElementID) int {
+	switch {
+	case uint32(id)&0xFFFFFF00 == 0:
+		return 1
+	case uint32(id)&0xFFFF0000 == 0:
+		return 2
+	case uint32(id)&0xFF000000 == 0:
+		return 3
+	default:
+		return 4
+	}
+}
+
+func (w *Writer) writeElementHeader(id ElementID, size int64) error {
+	idBuf := make([]byte, 4)
+	binary.BigEndian.PutUint32(idBuf, uint32(id))
+	idBuf = idBuf[4-idSize(id):]
+	if err := w.writeRaw(idBuf); err != nil {
+		return err
+	}
+	if size == UnknownSize {
+		return w.writeRaw([]byte{0xFF})
+	}
+	return w.writeRaw(encodeVInt(uint64(size), vintSize(uint64(size))))
+}
+
+// openMaster writes id's header and pushes it onto the open-element stack.
+// size may be UnknownSize, but only in two-pass mode: a plain Writer has
+// nowhere to seek back to and would have to emit a real EBML unknown-size
+// marker that this library's own Parse refuses to read.
+func (w *Writer) openMaster(id ElementID, size int64) error {
+	if size != UnknownSize && size < 0 {
+		return fmt.Errorf("mkvwriter: negative size for element %#x", id)
+	}
+	if size == UnknownSize && w.ws == nil {
+		return fmt.Errorf("mkvwriter: UnknownSize requires a two-pass Writer (see NewTwoPassWriter) for element %#x", id)
+	}
+	if size != UnknownSize {
+		if err := w.writeElementHeader(id, size); err != nil {
+			return err
+		}
+		w.stack = append(w.stack, openElement{id: id, sizeOffset: -1})
+		return nil
+	}
+
+	idBuf := make([]byte, 4)
+	binary.BigEndian.PutUint32(idBuf, uint32(id))
+	idBuf = idBuf[4-idSize(id):]
+	if err := w.writeRaw(idBuf); err != nil {
+		return err
+	}
+	// Reserve a real 8-octet size field we can backfill once the real size
+	// is known, written now as an 8-byte unknown-size marker.
+	sizeOffset := w.offset
+	if err := w.writeRaw([]byte{0x01, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}); err != nil {
+		return err
+	}
+	w.stack = append(w.stack, openElement{id: id, sizeOffset: sizeOffset})
+	return nil
+}
+
+// closeMaster pops id off the open-element stack, backfilling its size in
+// two-pass mode if it was opened with UnknownSize.
+func (w *Writer) closeMaster(id ElementID) error {
+	if len(w.stack) == 0 || w.stack[len(w.stack)-1].id != id {
+		return fmt.Errorf("mkvwriter: close of element %#x does not match the open element", id)
+	}
+	top := w.stack[len(w.stack)-1]
+	w.stack = w.stack[:len(w.stack)-1]
+
+	if top.sizeOffset < 0 || w.ws == nil {
+		return nil
+	}
+	size := w.offset - (top.sizeOffset + 8)
+	cur := w.offset
+	if _, err := w.ws.Seek(top.sizeOffset, io.SeekStart); err != nil {
+		return err
+	}
+	if err := w.writeRaw(encodeVInt(uint64(size), 8)); err != nil {
+		return err
+	}
+	w.offset = cur
+	_, err := w.ws.Seek(cur, io.SeekStart)
+	return err
+}
+
+func (w *Writer) writeLeaf(id ElementID, payload []byte) error {
+	if err := w.writeElementHeader(id, int64(len(payload))); err != nil {
+		return err
+	}
+	return w.writeRaw(payload)
+}
+
+func (w *Writer) writeUInteger(id ElementID, value uint64) error {
+	size := 1
+	for v := value >> 8; v != 0; v >>= 8 {
+		size++
+	}
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, value)
+	return w.writeLeaf(id, buf[8-size:])
+}
+
+func (w *Writer) writeInteger(id ElementID, value int64) error {
+	// Unlike writeUInteger, the minimal byte count can't be derived from
+	// the unsigned bit pattern: a negative value's high bytes are all
+	// 0xFF, so grow size only until value fits two's-complement in it.
+	size := 1
+	for size < 8 {
+		bits := uint(size) * 8
+		min := -(int64(1) << (bits - 1))
+		max := int64(1)<<(bits-1) - 1
+		if value >= min && value <= max {
+			break
+		}
+		size++
+	}
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, uint64(value))
+	return w.writeLeaf(id, buf[8-size:])
+}
+
+func (w *Writer) writeFloat(id ElementID, value float64) error {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, math.Float64bits(value))
+	return w.writeLeaf(id, buf)
+}
+
+func (w *Writer) writeString(id ElementID, value string) error {
+	return w.writeLeaf(id, []byte(value))
+}
+
+func (w *Writer) writeUTF8(id ElementID, value string) error {
+	return w.writeLeaf(id, []byte(value))
+}
+
+func (w *Writer) writeBinary(id ElementID, value []byte) error {
+	return w.writeLeaf(id, value)
+}
+
+func (w *Writer) writeDate(id ElementID, value time.Time) error {
+	return w.writeInteger(id, int64(value.Sub(matroskaEpoch)))
+}
@@ -0,0 +1,23 @@
+package mkvparse
+
+// ParserOptions controls optional, non-default behavior of Parse and
+// ParseSections. The zero value reproduces the historical behavior of both
+// functions.
+type ParserOptions struct {
+	// VerifyCRC enables validation of EBML CRC-32 elements (ID 0xBF). When a
+	// Master element's first child is a CRC-32 element, the remainder of
+	// the Master's payload is checksummed as it is read and checked
+	// against it; a mismatch
+	// is reported as a *CRCMismatchError. Verification is skipped for any
+	// Master entered via a seek, since the bytes preceding the seek point
+	// are not available to recompute the checksum.
+	VerifyCRC bool
+
+	// StrictEnums enables conformance checking of restricted elements.
+	// When a parsed uinteger, integer or string element has an enum
+	// restriction (i.e. EnumLabel would recognize it) and its value is not
+	// one of the allowed members, parsing stops with an
+	// *EnumValidationError instead of passing the out-of-range value to
+	// the Handler.
+	StrictEnums bool
+}
@@ -0,0 +1,424 @@
+package mkvparse
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// ElementID identifies an EBML element by its encoded ID, keeping the
+// VINT length-marker bits as part of the value (e.g. 0x1A45DFA3 for the
+// EBML header), since that is how element ID constants are conventionally
+// written in EBML-derived specs.
+type ElementID uint32
+
+// ElementInfo carries positional metadata about the element currently
+// being handled.
+type ElementInfo struct {
+	Offset int64
+	Size   int64
+}
+
+// Handler receives parsed EBML elements as Parse or ParseSections walks a
+// stream in depth-first order. Returning an error from any method, or
+// false from HandleMasterBegin, aborts further descent; a false return
+// from HandleMasterBegin is not itself an error; children of that Master
+// are skipped without being decoded.
+type Handler interface {
+	HandleMasterBegin(id ElementID, info ElementInfo) (bool, error)
+	HandleMasterEnd(id ElementID, info ElementInfo) error
+	HandleString(id ElementID, value string, info ElementInfo) error
+	HandleUTF8(id ElementID, value string, info ElementInfo) error
+	HandleInteger(id ElementID, value int64, info ElementInfo) error
+	HandleUInteger(id ElementID, value uint64, info ElementInfo) error
+	HandleFloat(id ElementID, value float64, info ElementInfo) error
+	HandleDate(id ElementID, value time.Time, info ElementInfo) error
+	HandleBinary(id ElementID, value []byte, info ElementInfo) error
+}
+
+type elementType int
+
+const (
+	masterType elementType = iota + 1
+	uintegerType
+	integerType
+	floatType
+	dateType
+	stringType
+	utf8Type
+	binaryType
+)
+
+// matroskaEpoch is the EBML Date reference point: 2001-01-01T00:00:00 UTC.
+var matroskaEpoch = time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Parse reads a single top-level EBML document from reader, invoking
+// handler's Handle* methods for each element in depth-first order. It does
+// not support elements with an unknown (all-ones) size.
+func Parse(reader io.Reader, handler Handler, options ...ParserOptions) error {
+	return parseDocument(reader, handler, resolveOptions(options), nil)
+}
+
+// ParseSections behaves like Parse but only descends into root-level
+// elements named in sections; other root-level elements are skipped
+// without being handed to handler. The EBML header is always read, since
+// its DocType selects the Schema used to recognize everything after it.
+func ParseSections(reader io.Reader, handler Handler, sections []ElementID, options ...ParserOptions) error {
+	return parseDocument(reader, handler, resolveOptions(options), sections)
+}
+
+func resolveOptions(options []ParserOptions) ParserOptions {
+	if len(options) == 0 {
+		return ParserOptions{}
+	}
+	return options[0]
+}
+
+type parser struct {
+	r        *bufio.Reader
+	offset   int64
+	options  ParserOptions
+	crcStack []*crcVerifier
+	docType  string
+}
+
+func parseDocument(r io.Reader, handler Handler, options ParserOptions, sections []ElementID) error {
+	p := &parser{r: bufio.NewReader(r), options: options}
+	activeSchema = SchemaEBMLHeader
+	for {
+		start := p.offset
+		id, size, err := p.readHeader()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if id != EBMLElement && activeSchema == SchemaEBMLHeader {
+			// No EBML header came first: use the fallback schema.
+			activeSchema = schemaForDocType(p.docType)
+		}
+		descend := sections == nil || id == EBMLElement || containsSection(sections, id)
+		if err := p.parseChild(id, size, handler, descend, start); err != nil {
+			return err
+		}
+		if id == EBMLElement {
+			activeSchema = schemaForDocType(p.docType)
+		}
+	}
+}
+
+func containsSection(sections []ElementID, id ElementID) bool {
+	for _, s := range sections {
+		if s == id {
+			return true
+		}
+	}
+	return false
+}
+
+// parseChildren reads id's children up to byte offset end. When
+// ParserOptions.VerifyCRC is set and id is a Master, a crcVerifier is
+// pushed for the duration so every byte subsequently read -- by this call
+// and any nested parseChildren -- is folded into id's running checksum,
+// except for id's own leading CRC-32 child, which the EBML spec excludes
+// from its own parent's coverage (its ID, size, and payload are all
+// excluded, not just the payload).
+func (p *parser) parseChildren(id ElementID, end int64, handler Handler, descend bool) error {
+	var crc *crcVerifier
+	if p.options.VerifyCRC && isMasterElement(id) {
+		crc = newCRCVerifier(id)
+		// The CRC-32 element's 1-byte VINT ID never collides with any other
+		// element's leading byte, so a 1-byte peek unambiguously tells us
+		// whether id's first child is its own CRC-32 before crc is pushed
+		// onto p.crcStack -- keeping its ID+size+payload bytes out of this
+		// checksum while still feeding any enclosing Master's own crc,
+		// already further down the stack. Only attempt the peek if id has
+		// room for a real CRC-32 child (1-byte ID + 1-byte size + 4-byte
+		// payload); otherwise the peeked byte, if any, belongs to the next
+		// sibling or the enclosing parent, not to id.
+		if end-p.offset >= 6 {
+			if peeked, err := p.r.Peek(1); err == nil && len(peeked) == 1 && peeked[0] == byte(CRC32Element) {
+				childID, childSize, err := p.readHeader()
+				if err != nil {
+					return err
+				}
+				if childID != CRC32Element || childSize != 4 {
+					return fmt.Errorf("mkvparse: CRC-32 element has size %d, want 4", childSize)
+				}
+				raw, err := p.readN(childSize)
+				if err != nil {
+					return err
+				}
+				crc.setExpected(binary.LittleEndian.Uint32(raw))
+			}
+		}
+		p.crcStack = append(p.crcStack, crc)
+		defer func() { p.crcStack = p.crcStack[:len(p.crcStack)-1] }()
+	}
+
+	for p.offset < end {
+		start := p.offset
+		childID, childSize, err := p.readHeader()
+		if err != nil {
+			return err
+		}
+		if err := p.parseChild(childID, childSize, handler, descend, start); err != nil {
+			return err
+		}
+	}
+
+	if crc != nil {
+		if err := crc.verify(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *parser) parseChild(id ElementID, size int64, handler Handler, descend bool, start int64) error {
+	if !descend {
+		return p.discard(size)
+	}
+	info := ElementInfo{Offset: start, Size: size}
+	switch getElementType(id) {
+	case masterType:
+		childDescend, err := handler.HandleMasterBegin(id, info)
+		if err != nil {
+			return err
+		}
+		if err := p.parseChildren(id, p.offset+size, handler, childDescend); err != nil {
+			return err
+		}
+		return handler.HandleMasterEnd(id, info)
+	case uintegerType:
+		raw, err := p.readN(size)
+		if err != nil {
+			return err
+		}
+		value := decodeUInt(raw)
+		if err := p.checkStrict(id, int64(value)); err != nil {
+			return err
+		}
+		return handler.HandleUInteger(id, value, info)
+	case integerType:
+		raw, err := p.readN(size)
+		if err != nil {
+			return err
+		}
+		value := decodeInt(raw)
+		if err := p.checkStrict(id, value); err != nil {
+			return err
+		}
+		return handler.HandleInteger(id, value, info)
+	case floatType:
+		raw, err := p.readN(size)
+		if err != nil {
+			return err
+		}
+		value, err := decodeFloat(raw)
+		if err != nil {
+			return err
+		}
+		return handler.HandleFloat(id, value, info)
+	case dateType:
+		raw, err := p.readN(size)
+		if err != nil {
+			return err
+		}
+		return handler.HandleDate(id, decodeDate(raw), info)
+	case stringType:
+		raw, err := p.readN(size)
+		if err != nil {
+			return err
+		}
+		value := string(raw)
+		if id == DocTypeElement {
+			p.docType = value
+		}
+		if err := p.checkStrict(id, value); err != nil {
+			return err
+		}
+		return handler.HandleString(id, value, info)
+	case utf8Type:
+		raw, err := p.readN(size)
+		if err != nil {
+			return err
+		}
+		return handler.HandleUTF8(id, string(raw), info)
+	case binaryType:
+		raw, err := p.readN(size)
+		if err != nil {
+			return err
+		}
+		return handler.HandleBinary(id, raw, info)
+	default:
+		// Unrecognized by the active schema; skip without surfacing it to
+		// handler rather than guessing at its semantics.
+		return p.discard(size)
+	}
+}
+
+func (p *parser) readHeader() (ElementID, int64, error) {
+	id, err := p.readVIntID()
+	if err != nil {
+		return 0, 0, err
+	}
+	size, err := p.readVIntSize()
+	if err != nil {
+		return 0, 0, err
+	}
+	return id, size, nil
+}
+
+func (p *parser) readByte() (byte, error) {
+	b, err := p.r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	p.offset++
+	p.feedCRC([]byte{b})
+	return b, nil
+}
+
+func (p *parser) readN(n int64) ([]byte, error) {
+	if n == 0 {
+		return nil, nil
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(p.r, buf); err != nil {
+		return nil, err
+	}
+	p.offset += n
+	p.feedCRC(buf)
+	return buf, nil
+}
+
+func (p *parser) discard(n int64) error {
+	if n == 0 {
+		return nil
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(p.r, buf); err != nil {
+		return err
+	}
+	p.offset += n
+	p.feedCRC(buf)
+	return nil
+}
+
+// checkStrict enforces ParserOptions.StrictEnums for a decoded leaf value,
+// returning its *EnumValidationError if value is out of range for id.
+func (p *parser) checkStrict(id ElementID, value interface{}) error {
+	if !p.options.StrictEnums {
+		return nil
+	}
+	return checkEnum(id, value)
+}
+
+func (p *parser) feedCRC(buf []byte) {
+	for _, v := range p.crcStack {
+		v.write(buf)
+	}
+}
+
+// readVIntID reads an EBML element ID VINT, keeping its length-marker bits
+// as part of the returned value.
+func (p *parser) readVIntID() (ElementID, error) {
+	first, err := p.readByte()
+	if err != nil {
+		return 0, err
+	}
+	n := vintLength(first)
+	if n == 0 {
+		return 0, fmt.Errorf("mkvparse: invalid element ID marker %#x", first)
+	}
+	value := uint32(first)
+	for i := 1; i < n; i++ {
+		b, err := p.readByte()
+		if err != nil {
+			return 0, err
+		}
+		value = value<<8 | uint32(b)
+	}
+	return ElementID(value), nil
+}
+
+// readVIntSize reads an EBML size VINT, stripping its length-marker bits.
+func (p *parser) readVIntSize() (int64, error) {
+	first, err := p.readByte()
+	if err != nil {
+		return 0, err
+	}
+	n := vintLength(first)
+	if n == 0 {
+		return 0, fmt.Errorf("mkvparse: invalid element size marker %#x", first)
+	}
+	value := uint64(first) &^ (0xFF << uint(8-n))
+	allOnes := value == uint64(1)<<uint(8-n)-1
+	for i := 1; i < n; i++ {
+		b, err := p.readByte()
+		if err != nil {
+			return 0, err
+		}
+		value = value<<8 | uint64(b)
+		if b != 0xFF {
+			allOnes = false
+		}
+	}
+	if allOnes {
+		return 0, fmt.Errorf("mkvparse: element has an unknown size, which Parse does not support")
+	}
+	return int64(value), nil
+}
+
+// vintLength returns the octet count of a VINT given its first byte, or 0
+// if the byte has no length-marker bit set.
+func vintLength(first byte) int {
+	for i := 0; i < 8; i++ {
+		if first&(0x80>>uint(i)) != 0 {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+func decodeUInt(raw []byte) uint64 {
+	var v uint64
+	for _, b := range raw {
+		v = v<<8 | uint64(b)
+	}
+	return v
+}
+
+func decodeInt(raw []byte) int64 {
+	v := decodeUInt(raw)
+	if len(raw) == 0 {
+		return 0
+	}
+	bits := uint(len(raw)) * 8
+	if raw[0]&0x80 != 0 && bits < 64 {
+		v |= ^uint64(0) << bits
+	}
+	return int64(v)
+}
+
+func decodeFloat(raw []byte) (float64, error) {
+	switch len(raw) {
+	case 0:
+		return 0, nil
+	case 4:
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(raw))), nil
+	case 8:
+		return math.Float64frombits(binary.BigEndian.Uint64(raw)), nil
+	default:
+		return 0, fmt.Errorf("mkvparse: invalid float element size %d", len(raw))
+	}
+}
+
+func decodeDate(raw []byte) time.Time {
+	return matroskaEpoch.Add(time.Duration(decodeInt(raw)))
+}
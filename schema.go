@@ -0,0 +1,91 @@
+package mkvparse
+
+// Schema abstracts over a single EBML DocType's element catalog. It lets
+// the parser switch element recognition and containment rules based on the
+// DocType (and, in principle, DocTypeVersion) declared in a stream's EBML
+// header, instead of hardcoding Matroska's rules for every stream.
+type Schema interface {
+	ElementType(id ElementID) elementType
+	Name(id ElementID) string
+	// IsDescendant reports whether descendant can occur nested anywhere
+	// beneath ancestor, e.g. IsDescendant(TracksElement, SegmentElement)
+	// is true because Tracks nests under Segment.
+	IsDescendant(descendant, ancestor ElementID) bool
+	IsRoot(id ElementID) bool
+	// EnumLabel returns the label for value if id has an enum restriction
+	// under this schema and value is one of its allowed members (an int64
+	// or a string, depending on the restricted element's type).
+	EnumLabel(id ElementID, value interface{}) (string, bool)
+	// EnumMembers returns the allowed labels for id under this schema, in
+	// declaration order, or nil if id has no enum restriction.
+	EnumMembers(id ElementID) []string
+}
+
+var schemaRegistry = map[string]Schema{}
+
+// RegisterSchema associates a Schema with an EBML DocType string (the
+// value of the stream's EBML\DocType element), overriding any schema
+// previously registered for that DocType. Parse and ParseSections consult
+// the registry after reading the EBML header to pick the schema that
+// governs the rest of the stream, falling back to SchemaMatroskaV4 for an
+// unrecognized DocType.
+func RegisterSchema(docType string, schema Schema) {
+	schemaRegistry[docType] = schema
+}
+
+func init() {
+	RegisterSchema("matroska", SchemaMatroskaV4)
+	RegisterSchema("webm", SchemaWebM)
+}
+
+// schemaForDocType returns the Schema registered for docType, or
+// SchemaMatroskaV4 if none was registered.
+func schemaForDocType(docType string) Schema {
+	if s, ok := schemaRegistry[docType]; ok {
+		return s
+	}
+	return SchemaMatroskaV4
+}
+
+// activeSchema is consulted by the package-level getElementType,
+// isDescendantElement, isRootElement and isMasterElement below. It exists
+// so code compiled against the pre-Schema API keeps working unchanged;
+// Parse and ParseSections update it to match the stream's DocType before
+// parsing the body. New code should prefer schemaForDocType and the Schema
+// interface directly.
+var activeSchema Schema = SchemaMatroskaV4
+
+func getElementType(el ElementID) elementType {
+	return activeSchema.ElementType(el)
+}
+
+// isDescendantElement reports whether descendant can occur nested anywhere
+// beneath ancestor under the active schema.
+func isDescendantElement(descendant, ancestor ElementID) bool {
+	return activeSchema.IsDescendant(descendant, ancestor)
+}
+
+func isRootElement(el ElementID) bool {
+	return activeSchema.IsRoot(el)
+}
+
+// isMasterElement reports whether el is a Master element under the active
+// schema, i.e. one that can carry a CRC-32 element (ID 0xBF) as its first
+// child.
+func isMasterElement(el ElementID) bool {
+	return activeSchema.ElementType(el) == masterType
+}
+
+// EnumLabel returns the label activeSchema assigns to value for element el.
+// StrictEnums and external callers use this instead of a flat, schema-
+// agnostic catalog so a stream's DocType (or a schema registered via
+// RegisterSchema) governs which restriction set applies.
+func EnumLabel(el ElementID, value interface{}) (string, bool) {
+	return activeSchema.EnumLabel(el, value)
+}
+
+// enumMembers returns the allowed labels for el under the active schema, or
+// nil if el has no enum restriction.
+func enumMembers(el ElementID) []string {
+	return activeSchema.EnumMembers(el)
+}
@@ -0,0 +1,72 @@
+package mkvparse
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSchemaForDocType(t *testing.T) {
+	cases := []struct {
+		docType string
+		want    Schema
+	}{
+		{"matroska", SchemaMatroskaV4},
+		{"webm", SchemaWebM},
+		{"some-unrecognized-doctype", SchemaMatroskaV4},
+	}
+	for _, c := range cases {
+		if got := schemaForDocType(c.docType); got != c.want {
+			t.Errorf("schemaForDocType(%q) = %v, want %v", c.docType, got, c.want)
+		}
+	}
+}
+
+// trackingHandler embeds noopHandler and additionally records whether a
+// Master with the given ID was decoded as one, rather than silently
+// discarded by an inactive schema.
+type trackingHandler struct {
+	noopHandler
+	want ElementID
+	saw  bool
+}
+
+func (h *trackingHandler) HandleMasterBegin(id ElementID, info ElementInfo) (bool, error) {
+	if id == h.want {
+		h.saw = true
+	}
+	return true, nil
+}
+
+// TestParseSwitchesActiveSchemaByDocType checks that Parse actually acts on
+// a stream's declared DocType instead of leaving SchemaMatroskaV4 active
+// regardless: BlockAdditionMapping is WebM-only, so it only reaches
+// HandleMasterBegin once the EBML header's DocType says "webm".
+func TestParseSwitchesActiveSchemaByDocType(t *testing.T) {
+	header := encodeElement(EBMLElement, encodeElement(DocTypeElement, []byte("webm")))
+	segment := encodeElement(SegmentElement, encodeElement(BlockAdditionMappingElement, nil))
+	data := append(header, segment...)
+
+	h := &trackingHandler{want: BlockAdditionMappingElement}
+	if err := Parse(bytes.NewReader(data), h); err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if !h.saw {
+		t.Fatal("BlockAdditionMapping was not decoded as a Master; DocType-based schema switching did not take effect")
+	}
+}
+
+// customSchema wraps another Schema unmodified, just so it is a distinct,
+// identifiable value for TestRegisterSchemaCustom to register and look up.
+type customSchema struct {
+	Schema
+}
+
+func TestRegisterSchemaCustom(t *testing.T) {
+	custom := customSchema{Schema: SchemaMatroskaV4}
+	RegisterSchema("x-custom", custom)
+	t.Cleanup(func() { delete(schemaRegistry, "x-custom") })
+
+	if got := schemaForDocType("x-custom"); got != Schema(custom) {
+		t.Fatalf("schemaForDocType(%q) = %v, want the registered custom schema", "x-custom", got)
+	}
+}